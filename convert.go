@@ -12,6 +12,7 @@ package main
 
 import (
 	"bufio"
+	"compress/flate"
 	"encoding/binary"
 	"flag"
 	"fmt"
@@ -36,6 +37,11 @@ var (
 	applyOffset = flag.Bool("offset", true, "apply offset to values")
 	startOffset = flag.Float64("start-at", 0, "starting offset (in milliseconds) to process from")
 	decimate    = flag.Int("decimate", 1, "apply decimation factor to waveform")
+
+	compressLevel = flag.Int("compress-level", flate.DefaultCompression, "Deflate compression level (-1 to 9) for the srzip output")
+	parallel      = flag.Int("parallel", 0, "number of workers to compress srzip part files concurrently (0 disables)")
+
+	doRead = flag.Bool("read", false, "read back an existing .sr file instead of converting a Siglent binary, dumping it to CSV")
 )
 
 //////////////////////////////////////////////////
@@ -81,10 +87,21 @@ func main() {
 		fmt.Println("decimation factor cannot be less than 1")
 		return
 	}
+	if *compressLevel < flate.HuffmanOnly || *compressLevel > flate.BestCompression {
+		fmt.Printf("compress-level must be between %d and %d\n", flate.HuffmanOnly, flate.BestCompression)
+		return
+	}
 
 	fname := flag.Arg(0)
 	fmt.Printf("fname %s\n", fname)
 
+	if *doRead {
+		if err := readSrZip(fname); err != nil {
+			fmt.Printf("cannot read srzip: %v\n", err)
+		}
+		return
+	}
+
 	file, err := os.Open(fname)
 	if err != nil {
 		panic(err)
@@ -137,6 +154,8 @@ func main() {
 		}
 
 		sr.SampleRate = uint(dataSpec.SampleRate / float64(*decimate))
+		sr.SetCompression(*compressLevel)
+		sr.Parallel(*parallel)
 		defer sr.Close()
 	}
 
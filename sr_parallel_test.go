@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zip"
+)
+
+// TestCompressionLevel checks that SetCompression actually changes the
+// output size in the default (non-Parallel) path, where part files are
+// written straight into the zip.Writer rather than through the worker
+// pool's own flate.Writer.
+func TestCompressionLevel(t *testing.T) {
+	write := func(level int) int64 {
+		name := filepath.Join(t.TempDir(), "level.sr")
+
+		sr, err := NewSrZipFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sr.SampleRate = 1000
+		sr.SetCompression(level)
+
+		ch := sr.NewAnalogChannel("Ch 1")
+		for i := 0; i < 50000; i++ {
+			if err := ch.Write(1.0); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := sr.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.Size()
+	}
+
+	none := write(0)
+	best := write(9)
+	if none <= best {
+		t.Fatalf("compression level had no effect: level 0 = %d bytes, level 9 = %d bytes", none, best)
+	}
+}
+
+// TestParallelRoundTrip checks that Parallel(n) still produces a correctly
+// ordered, correctly decompressed archive: part files must land in the
+// central directory in creation order even though their compression
+// happens concurrently and out of order.
+func TestParallelRoundTrip(t *testing.T) {
+	const numSamples = SamplesLimit + 10 // force a second part per channel
+
+	name := filepath.Join(t.TempDir(), "parallel.sr")
+
+	sr, err := NewSrZipFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sr.SampleRate = 1000
+	sr.Parallel(4)
+
+	ch1 := sr.NewAnalogChannel("Ch 1")
+	ch2 := sr.NewAnalogChannel("Ch 2")
+
+	for i := 0; i < numSamples; i++ {
+		if err := ch1.Write(float32(i)); err != nil {
+			t.Fatal(err)
+		}
+		if err := ch2.Write(float32(-i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sr.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+
+	want := []string{
+		"analog-1-1-1", "analog-1-2-1",
+		"analog-1-1-2", "analog-1-2-2",
+		"version", "metadata",
+	}
+	if len(zr.File) != len(want) {
+		t.Fatalf("got %d central directory entries, want %d", len(zr.File), len(want))
+	}
+	for i, f := range zr.File {
+		if f.Name != want[i] {
+			t.Fatalf("central directory entry %d = %q, want %q (full order: %v)", i, f.Name, want[i], want)
+		}
+	}
+
+	r, err := OpenSrZipReader(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	analog := r.AnalogChannels()
+	if len(analog) != 2 {
+		t.Fatalf("got %d analog channels, want 2", len(analog))
+	}
+
+	for i := 0; i < numSamples; i++ {
+		v1, ok, err := analog[0].Next()
+		if err != nil {
+			t.Fatalf("sample %d ch1: %v", i, err)
+		}
+		if !ok {
+			t.Fatalf("sample %d: ch1 ran out early", i)
+		}
+		if v1 != float32(i) {
+			t.Fatalf("sample %d: ch1 = %v, want %v", i, v1, float32(i))
+		}
+
+		v2, ok, err := analog[1].Next()
+		if err != nil {
+			t.Fatalf("sample %d ch2: %v", i, err)
+		}
+		if !ok {
+			t.Fatalf("sample %d: ch2 ran out early", i)
+		}
+		if v2 != float32(-i) {
+			t.Fatalf("sample %d: ch2 = %v, want %v", i, v2, float32(-i))
+		}
+	}
+}
@@ -0,0 +1,363 @@
+//
+// Reads back files of the Sigrok Zip format (srzip) written by SrZip, for
+// re-decimation, concatenation, or conversion to other formats without
+// going back to the raw Siglent binary.
+// See https://sigrok.org/wiki/File_format:Sigrok/v2
+//
+// Copyright 2020-2021 Darell Tan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the README file.
+//
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zip"
+)
+
+type SrZipReader struct {
+	zr *zip.ReadCloser
+
+	SampleRate uint
+	channels   []*AnalogChannelReader
+	logic      []*LogicChannelReader
+	unitSize   int
+}
+
+// OpenSrZipReader opens an existing .sr archive and parses its metadata.
+func OpenSrZipReader(name string) (*SrZipReader, error) {
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &SrZipReader{zr: zr}
+	if err := r.readVersion(); err != nil {
+		zr.Close()
+		return nil, err
+	}
+	if err := r.readMetadata(); err != nil {
+		zr.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *SrZipReader) readVersion() error {
+	f, err := r.zr.Open("version")
+	if err != nil {
+		return fmt.Errorf("can't open version: %w", err)
+	}
+	defer f.Close()
+
+	v, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(v)) != "2" {
+		return fmt.Errorf("unsupported srzip version %q", strings.TrimSpace(string(v)))
+	}
+	return nil
+}
+
+// readMetadata parses the INI-style "metadata" file: a "[device 1]"
+// section followed by "key=value" lines, as written by SrZip.Close.
+func (r *SrZipReader) readMetadata() error {
+	f, err := r.zr.Open("metadata")
+	if err != nil {
+		return fmt.Errorf("can't open metadata: %w", err)
+	}
+	defer f.Close()
+
+	analogNames := map[int]string{}
+	probeNames := map[int]string{}
+	totalAnalog := 0
+	totalProbes := 0
+
+	sc := bufio.NewScanner(f)
+	section := ""
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = strings.TrimSuffix(strings.TrimPrefix(line, "["), "]")
+			continue
+		case section != "device 1":
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+
+		switch {
+		case key == "samplerate":
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("bad samplerate %q: %w", value, err)
+			}
+			r.SampleRate = uint(n)
+		case key == "total analog":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("bad total analog %q: %w", value, err)
+			}
+			totalAnalog = n
+		case key == "total probes":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("bad total probes %q: %w", value, err)
+			}
+			totalProbes = n
+		case key == "unitsize":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("bad unitsize %q: %w", value, err)
+			}
+			r.unitSize = n
+		case strings.HasPrefix(key, "analog"):
+			n, err := strconv.Atoi(strings.TrimPrefix(key, "analog"))
+			if err != nil {
+				return fmt.Errorf("bad analog channel key %q: %w", key, err)
+			}
+			analogNames[n] = value
+		case strings.HasPrefix(key, "probe"):
+			n, err := strconv.Atoi(strings.TrimPrefix(key, "probe"))
+			if err != nil {
+				return fmt.Errorf("bad probe key %q: %w", key, err)
+			}
+			probeNames[n] = value
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	for n := 1; n <= totalAnalog; n++ {
+		r.channels = append(r.channels, &AnalogChannelReader{
+			zr: r.zr, channel: n, name: analogNames[n],
+		})
+	}
+	for n := 1; n <= totalProbes; n++ {
+		r.logic = append(r.logic, &LogicChannelReader{
+			zr: r.zr, probe: n, name: probeNames[n], unitSize: r.unitSize,
+		})
+	}
+
+	return nil
+}
+
+// AnalogChannels returns a reader for each analog channel, in channel order.
+func (r *SrZipReader) AnalogChannels() []*AnalogChannelReader { return r.channels }
+
+// LogicChannels returns a reader for each digital probe, in probe order.
+func (r *SrZipReader) LogicChannels() []*LogicChannelReader { return r.logic }
+
+func (r *SrZipReader) Close() error { return r.zr.Close() }
+
+// AnalogChannelReader iterates over one analog channel's samples,
+// transparently crossing the analog-1-<ch>-<part> part file boundaries.
+type AnalogChannelReader struct {
+	zr      *zip.ReadCloser
+	channel int
+	name    string
+
+	part int
+	r    io.ReadCloser
+}
+
+func (c *AnalogChannelReader) Name() string { return c.name }
+
+// Next returns the next sample. ok is false once every part has been
+// exhausted.
+func (c *AnalogChannelReader) Next() (v float32, ok bool, err error) {
+	for {
+		if c.r == nil {
+			opened, err := c.openNextPart()
+			if err != nil {
+				return 0, false, err
+			}
+			if !opened {
+				return 0, false, nil
+			}
+		}
+
+		var buf [4]byte
+		_, err = io.ReadFull(c.r, buf[:])
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			c.r.Close()
+			c.r = nil
+			continue
+		} else if err != nil {
+			return 0, false, err
+		}
+
+		return math.Float32frombits(binary.LittleEndian.Uint32(buf[:])), true, nil
+	}
+}
+
+func (c *AnalogChannelReader) openNextPart() (bool, error) {
+	c.part++
+	name := fmt.Sprintf("analog-1-%d-%d", c.channel, c.part)
+
+	f, err := c.zr.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil // no more parts
+	} else if err != nil {
+		return false, err
+	}
+	c.r = f
+	return true, nil
+}
+
+// LogicChannelReader iterates over one digital probe's samples,
+// unpacking its bit out of the shared logic-1-<part> stream.
+type LogicChannelReader struct {
+	zr       *zip.ReadCloser
+	probe    int
+	name     string
+	unitSize int
+
+	part int
+	r    io.ReadCloser
+}
+
+func (c *LogicChannelReader) Name() string { return c.name }
+
+func (c *LogicChannelReader) Next() (bit bool, ok bool, err error) {
+	for {
+		if c.r == nil {
+			opened, err := c.openNextPart()
+			if err != nil {
+				return false, false, err
+			}
+			if !opened {
+				return false, false, nil
+			}
+		}
+
+		sample := make([]byte, c.unitSize)
+		_, err = io.ReadFull(c.r, sample)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			c.r.Close()
+			c.r = nil
+			continue
+		} else if err != nil {
+			return false, false, err
+		}
+
+		probeIdx := c.probe - 1
+		bit = sample[probeIdx/8]&(1<<uint(probeIdx%8)) != 0
+		return bit, true, nil
+	}
+}
+
+func (c *LogicChannelReader) openNextPart() (bool, error) {
+	c.part++
+	name := fmt.Sprintf("logic-1-%d", c.part)
+
+	f, err := c.zr.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil // no more parts
+	} else if err != nil {
+		return false, err
+	}
+	c.r = f
+	return true, nil
+}
+
+// readSrZip demonstrates SrZipReader by dumping every analog and logic
+// channel of an existing .sr archive to a CSV file, one column per channel.
+func readSrZip(fname string) error {
+	r, err := OpenSrZipReader(fname)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	fmt.Printf("samplerate: %d\n", r.SampleRate)
+
+	analog := r.AnalogChannels()
+	logic := r.LogicChannels()
+
+	outName := fname + ".csv"
+	outFile, err := os.OpenFile(outName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	w := bufio.NewWriter(outFile)
+
+	hdr := make([]string, 0, len(analog)+len(logic))
+	for _, ch := range analog {
+		hdr = append(hdr, ch.Name())
+	}
+	for _, ch := range logic {
+		hdr = append(hdr, ch.Name())
+	}
+	fmt.Fprintln(w, strings.Join(hdr, ","))
+
+	rows := 0
+	for {
+		row := make([]string, 0, len(hdr))
+		any := false
+
+		for _, ch := range analog {
+			v, ok, err := ch.Next()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				row = append(row, "")
+				continue
+			}
+			any = true
+			row = append(row, strconv.FormatFloat(float64(v), 'g', -1, 32))
+		}
+		for _, ch := range logic {
+			bit, ok, err := ch.Next()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				row = append(row, "")
+				continue
+			}
+			any = true
+			if bit {
+				row = append(row, "1")
+			} else {
+				row = append(row, "0")
+			}
+		}
+
+		if !any {
+			break
+		}
+		fmt.Fprintln(w, strings.Join(row, ","))
+		rows++
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("wrote %d samples to %s\n", rows, outName)
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zip"
+)
+
+// TestAnalogChannelReaderPropagatesPartError hand-builds a valid .sr
+// archive and then corrupts the second part's local file header, and
+// checks that AnalogChannelReader.Next reports the resulting error
+// instead of treating it as "no more parts" the way a genuinely missing
+// part legitimately is.
+func TestAnalogChannelReaderPropagatesPartError(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "corrupt.sr")
+
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "version", Method: zip.Deflate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("2\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err = zw.CreateHeader(&zip.FileHeader{Name: "metadata", Method: zip.Deflate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("\n[device 1]\nsamplerate=1000\ntotal analog=1\nanalog1=Ch 1\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err = zw.CreateHeader(&zip.FileHeader{Name: "analog-1-1-1", Method: zip.Deflate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], math.Float32bits(1.5))
+	if _, err := w.Write(buf[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err = zw.CreateHeader(&zip.FileHeader{Name: "analog-1-1-2", Method: zip.Deflate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.LittleEndian.PutUint32(buf[:], math.Float32bits(2.5))
+	if _, err := w.Write(buf[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flip the first byte of "analog-1-1-2"'s local file header signature
+	// (the 4 bytes immediately preceding the fixed 30-byte header that
+	// ends with the entry's name) so re-opening that part fails with a
+	// format error rather than fs.ErrNotExist.
+	raw, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nameBytes := []byte("analog-1-1-2")
+	sig := []byte{0x50, 0x4b, 0x03, 0x04}
+	found := false
+	for i := bytes.Index(raw, nameBytes); i >= 30; {
+		hdrStart := i - 30
+		if bytes.Equal(raw[hdrStart:hdrStart+4], sig) {
+			raw[hdrStart] ^= 0xff
+			found = true
+			break
+		}
+		next := bytes.Index(raw[i+1:], nameBytes)
+		if next < 0 {
+			break
+		}
+		i += 1 + next
+	}
+	if !found {
+		t.Fatal("could not locate analog-1-1-2's local file header to corrupt")
+	}
+	if err := os.WriteFile(name, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenSrZipReader(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	ch := r.AnalogChannels()[0]
+
+	v, ok, err := ch.Next()
+	if err != nil || !ok || v != 1.5 {
+		t.Fatalf("first sample: v=%v ok=%v err=%v, want 1.5, true, nil", v, ok, err)
+	}
+
+	if _, ok, err := ch.Next(); err == nil {
+		t.Fatalf("expected an error reading the corrupted part, got ok=%v err=nil", ok)
+	}
+}
@@ -10,35 +10,100 @@
 package main
 
 import (
-	"archive/zip"
+	"bytes"
+	"compress/flate"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"math"
 	"os"
+	"sync"
+
+	"github.com/klauspost/compress/zip"
 )
 
 // Maximum number of samples in each file part
 const SamplesLimit = 0x280000
 
+// No explicit Zip64 opt-in is needed here: every part file is created via
+// CreateHeader without a pre-declared size, so the writer (both archive/zip
+// and github.com/klauspost/compress/zip, which this package now uses) only
+// learns the final size once the entry is closed, and at that point it
+// always emits 64-bit size fields in the data descriptor and central
+// directory record if the size, offset, or entry count crossed the 32-bit
+// limit. That's exactly what deep-memory/many-part captures need, and it's
+// covered by TestZip64EntryCountBoundary.
+
 type SrZip struct {
 	zipFile *zip.Writer
 
 	channels   []*AnalogChannel
+	logic      logicStream
 	SampleRate uint
+
+	level   int // Deflate level passed to compress/flate; see SetCompression
+	workers int // size of the compression worker pool; see Parallel
+
+	jobs     chan *partJob // fed to the worker pool; compressed out of order
+	pending  chan *partJob // drained by writeLoop strictly in submission order
+	wg       sync.WaitGroup
+	start    sync.Once
+	compReg  sync.Once
+	asyncErr error // first error observed by a worker or writeLoop
+
+	flatePool sync.Pool // reusable *flate.Writer at sr.level; see newFlateWriter
+}
+
+// partJob carries one part file's buffered contents through the worker
+// pool to writeLoop, which writes it to the archive once compressed.
+type partJob struct {
+	name string
+	data []byte
+
+	compressed []byte
+	crc        uint32
+	err        error
+	done       chan struct{}
 }
 
 type AnalogChannel struct {
 	samples uint64
 	part    int
 	w       io.Writer
+	buf     *bytes.Buffer // non-nil while the part is being buffered for the worker pool
+	curPart string        // name of the part file currently open
+
 	srzip   *SrZip
 	channel int
 	name    string
 }
 
+// logicStream holds the single shared "logic-1-<part>" part file that all
+// LogicChannels pack their bits into, since srzip interleaves every probe
+// into one stream rather than giving each its own part file like analog
+// channels do.
+type logicStream struct {
+	channels []*LogicChannel
+	unitSize int    // bytes per sample; (len(channels)+7)/8
+	sample   []byte // in-progress sample; filled in as each probe writes its bit
+	filled   int    // number of probes that have written a bit into sample so far
+
+	samples uint64
+	part    int
+	w       io.Writer
+	buf     *bytes.Buffer
+	curPart string
+}
+
+type LogicChannel struct {
+	probe int // 1-based probe number, as used in the probe<n>= metadata key
+	name  string
+	srzip *SrZip
+}
+
 func NewSrZip(zipFile *zip.Writer) *SrZip {
-	return &SrZip{zipFile: zipFile}
+	return &SrZip{zipFile: zipFile, level: flate.DefaultCompression}
 }
 
 // Convenience method to specify just a filename.
@@ -50,8 +115,180 @@ func NewSrZipFile(name string) (*SrZip, error) {
 	return NewSrZip(zip.NewWriter(w)), nil
 }
 
+// SetCompression sets the Deflate level (see compress/flate) used for every
+// part file created from here on. Must be called before the first channel
+// is created.
+func (sr *SrZip) SetCompression(level int) {
+	sr.level = level
+}
+
+// Parallel runs n workers that Deflate part files concurrently with the
+// main goroutine producing samples. Parts are still written to the
+// archive's central directory in the order they were created; only the
+// (CPU-bound) compression itself runs out of order. Must be called before
+// the first channel is created; n < 1 keeps part files streaming straight
+// into the archive as before.
+func (sr *SrZip) Parallel(n int) {
+	sr.workers = n
+}
+
+func (sr *SrZip) startWorkers() {
+	sr.start.Do(func() {
+		if sr.workers < 1 {
+			return
+		}
+
+		sr.jobs = make(chan *partJob, sr.workers)
+		sr.pending = make(chan *partJob, sr.workers*4)
+
+		for i := 0; i < sr.workers; i++ {
+			sr.wg.Add(1)
+			go sr.compressWorker()
+		}
+
+		sr.wg.Add(1)
+		go sr.writeLoop()
+	})
+}
+
+func (sr *SrZip) compressWorker() {
+	defer sr.wg.Done()
+	for job := range sr.jobs {
+		var buf bytes.Buffer
+		fw, err := sr.newFlateWriter(&buf)
+		if err == nil {
+			_, err = fw.Write(job.data)
+		}
+		if err == nil {
+			err = fw.Close()
+		}
+		if fw != nil {
+			sr.flatePool.Put(fw)
+		}
+
+		job.err = err
+		job.compressed = buf.Bytes()
+		job.crc = crc32.ChecksumIEEE(job.data)
+		close(job.done)
+	}
+}
+
+// newFlateWriter returns a *flate.Writer at sr.level, reusing one from
+// flatePool when possible. compress/flate pre-allocates large hash-chain
+// buffers per writer regardless of input size, so with many small part
+// files (e.g. thousands of near-empty analog channels) allocating a fresh
+// one each time balloons memory; callers must return it via flatePool.Put
+// once done. The only way this fails is an out-of-range sr.level.
+func (sr *SrZip) newFlateWriter(w io.Writer) (*flate.Writer, error) {
+	if fw, ok := sr.flatePool.Get().(*flate.Writer); ok {
+		fw.Reset(w)
+		return fw, nil
+	}
+	return flate.NewWriter(w, sr.level)
+}
+
+// writeLoop drains pending part jobs strictly in the order they were
+// created, so the central directory always lists parts in order even
+// though they may finish compressing out of order.
+func (sr *SrZip) writeLoop() {
+	defer sr.wg.Done()
+	for job := range sr.pending {
+		<-job.done
+
+		if job.err != nil {
+			if sr.asyncErr == nil {
+				sr.asyncErr = job.err
+			}
+			continue
+		}
+
+		if err := sr.writeRaw(job); err != nil && sr.asyncErr == nil {
+			sr.asyncErr = err
+		}
+	}
+}
+
+func (sr *SrZip) writeRaw(job *partJob) error {
+	fh := &zip.FileHeader{
+		Name:               job.name,
+		Method:             zip.Deflate,
+		CRC32:              job.crc,
+		CompressedSize64:   uint64(len(job.compressed)),
+		UncompressedSize64: uint64(len(job.data)),
+	}
+
+	w, err := sr.zipFile.CreateRaw(fh)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(job.compressed)
+	return err
+}
+
+// registerCompressor makes the zip.Deflate method honor sr.level for every
+// entry the zip.Writer compresses itself. It only affects the direct
+// (non-worker-pool) path and the "version"/"metadata" files; compressWorker
+// applies sr.level on its own when a worker pool is running (see Parallel).
+func (sr *SrZip) registerCompressor() {
+	sr.compReg.Do(func() {
+		sr.zipFile.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+			fw, err := sr.newFlateWriter(w)
+			if err != nil {
+				return nil, err
+			}
+			return &pooledFlateWriter{sr: sr, fw: fw}, nil
+		})
+	})
+}
+
+// pooledFlateWriter returns its *flate.Writer to sr.flatePool on Close, so
+// registerCompressor doesn't leak one per part file the way a bare
+// flate.NewWriter call per entry would.
+type pooledFlateWriter struct {
+	sr *SrZip
+	fw *flate.Writer
+}
+
+func (w *pooledFlateWriter) Write(p []byte) (int, error) { return w.fw.Write(p) }
+
+func (w *pooledFlateWriter) Close() error {
+	err := w.fw.Close()
+	w.sr.flatePool.Put(w.fw)
+	return err
+}
+
+// createPart opens a new part file. When a worker pool is running (see
+// Parallel), the returned writer just buffers its contents in memory and
+// Deflate compression plus the directory write happen asynchronously; see
+// closePart. Otherwise it streams straight into the archive as before.
+func (sr *SrZip) createPart(name string) (io.Writer, *bytes.Buffer, error) {
+	sr.startWorkers()
+	if sr.jobs == nil {
+		sr.registerCompressor()
+		w, err := sr.zipFile.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		return w, nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	return buf, buf, nil
+}
+
+// closePart hands a finished part's buffered bytes to the worker pool.
+// It's a no-op for parts that weren't buffered (no worker pool running).
+func (sr *SrZip) closePart(name string, buf *bytes.Buffer) error {
+	if buf == nil {
+		return nil
+	}
+
+	job := &partJob{name: name, data: buf.Bytes(), done: make(chan struct{})}
+	sr.jobs <- job
+	sr.pending <- job
+	return nil
+}
+
 func (sr *SrZip) createFile(name, contents string) error {
-	w, err := sr.zipFile.Create(name)
+	sr.registerCompressor()
+	w, err := sr.zipFile.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
 	if err != nil {
 		return err
 	}
@@ -60,6 +297,28 @@ func (sr *SrZip) createFile(name, contents string) error {
 }
 
 func (sr *SrZip) Close() error {
+	for _, ch := range sr.channels {
+		if err := sr.closePart(ch.curPart, ch.buf); err != nil {
+			return err
+		}
+		ch.buf = nil
+	}
+	if len(sr.logic.channels) > 0 {
+		if err := sr.closePart(sr.logic.curPart, sr.logic.buf); err != nil {
+			return err
+		}
+		sr.logic.buf = nil
+	}
+
+	if sr.jobs != nil {
+		close(sr.jobs)
+		close(sr.pending)
+		sr.wg.Wait()
+	}
+	if sr.asyncErr != nil {
+		return sr.asyncErr
+	}
+
 	err := sr.createFile("version", "2\n")
 	if err != nil {
 		return err
@@ -76,6 +335,13 @@ total analog=%d
 		metadata += fmt.Sprintf("analog%d=%s\n", ch.channel, ch.name)
 	}
 
+	if n := len(sr.logic.channels); n > 0 {
+		metadata += fmt.Sprintf("unitsize=%d\ntotal probes=%d\n", sr.logic.unitSize, n)
+		for _, ch := range sr.logic.channels {
+			metadata += fmt.Sprintf("probe%d=%s\n", ch.probe, ch.name)
+		}
+	}
+
 	err = sr.createFile("metadata", metadata)
 	if err != nil {
 		return err
@@ -84,6 +350,80 @@ total analog=%d
 	return sr.zipFile.Close()
 }
 
+// NewLogicChannel adds a digital probe to the archive. All probes share a
+// single "logic-1-<part>" stream, so NewLogicChannel must be called for
+// every probe before the first Write to any of them.
+func (sr *SrZip) NewLogicChannel(name string) *LogicChannel {
+	c := &LogicChannel{srzip: sr, name: name, probe: len(sr.logic.channels) + 1}
+	sr.logic.channels = append(sr.logic.channels, c)
+
+	sr.logic.unitSize = (len(sr.logic.channels) + 7) / 8
+	sr.logic.sample = make([]byte, sr.logic.unitSize)
+
+	return c
+}
+
+// Write packs a single probe's sample bit into the shared logic stream.
+// Once every probe registered via NewLogicChannel has written its bit for
+// the current sample, the completed byte(s) are flushed to the archive.
+func (c *LogicChannel) Write(bit bool) error {
+	return c.srzip.logic.writeBit(c.srzip, c.probe-1, bit)
+}
+
+func (l *logicStream) writeBit(sr *SrZip, probeIdx int, bit bool) error {
+	if bit {
+		l.sample[probeIdx/8] |= 1 << uint(probeIdx%8)
+	}
+
+	l.filled++
+	if l.filled < len(l.channels) {
+		return nil
+	}
+	l.filled = 0
+
+	return l.flush(sr)
+}
+
+// flush writes out the completed sample and handles splitting into parts,
+// the same way AnalogChannel.update does for analog channels.
+func (l *logicStream) flush(sr *SrZip) error {
+	if l.w == nil {
+		if err := l.openPart(sr); err != nil {
+			return err
+		}
+	}
+
+	if _, err := l.w.Write(l.sample); err != nil {
+		return err
+	}
+	for i := range l.sample {
+		l.sample[i] = 0
+	}
+
+	l.samples++
+	if l.samples%SamplesLimit == 0 {
+		return l.openPart(sr)
+	}
+	return nil
+}
+
+func (l *logicStream) openPart(sr *SrZip) error {
+	if err := sr.closePart(l.curPart, l.buf); err != nil {
+		return err
+	}
+
+	l.part++
+	l.curPart = fmt.Sprintf("logic-1-%d", l.part)
+
+	w2, buf, err := sr.createPart(l.curPart)
+	if err != nil {
+		return errors.New("can't create part for logic channels")
+	}
+
+	l.w, l.buf = w2, buf
+	return nil
+}
+
 func (sr *SrZip) NewAnalogChannel(name string) *AnalogChannel {
 	c := &AnalogChannel{srzip: sr, name: name, channel: len(sr.channels) + 1}
 	sr.channels = append(sr.channels, c)
@@ -109,15 +449,19 @@ func (c *AnalogChannel) Write(v float32) error {
 // Handles splitting of channel data into parts
 func (c *AnalogChannel) update() error {
 	if c.samples%SamplesLimit == 0 {
+		if err := c.srzip.closePart(c.curPart, c.buf); err != nil {
+			return err
+		}
+
 		c.part++
+		c.curPart = fmt.Sprintf("analog-1-%d-%d", c.channel, c.part)
 
-		name := fmt.Sprintf("analog-1-%d-%d", c.channel, c.part)
-		w2, err := c.srzip.zipFile.Create(name)
+		w2, buf, err := c.srzip.createPart(c.curPart)
 		if err != nil {
 			return errors.New("can't create part for analog ch " + c.name)
 		}
 
-		c.w = w2
+		c.w, c.buf = w2, buf
 	}
 	return nil
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestZip64EntryCountBoundary writes an archive with more than 65535
+// entries (the point at which the zip format can no longer represent the
+// entry count in its regular end-of-central-directory record, and a
+// writer must fall back to Zip64) and checks it still round-trips. No
+// code in this package has to do anything special for this to work: see
+// the comment above SamplesLimit in sr_writer.go.
+func TestZip64EntryCountBoundary(t *testing.T) {
+	const numChannels = 70000 // > 65535, the non-Zip64 entry count limit
+
+	name := filepath.Join(t.TempDir(), "boundary.sr")
+
+	sr, err := NewSrZipFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sr.SampleRate = 1000
+	for i := 0; i < numChannels; i++ {
+		sr.NewAnalogChannel("Ch")
+	}
+	if err := sr.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenSrZipReader(name)
+	if err != nil {
+		t.Fatalf("can't reopen archive past the entry-count boundary: %v", err)
+	}
+	defer r.Close()
+
+	if got := len(r.AnalogChannels()); got != numChannels {
+		t.Fatalf("got %d analog channels, want %d", got, numChannels)
+	}
+}